@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -26,13 +28,35 @@ import (
 	"github.com/grafana/loki/pkg/storage/stores/shipper/indexgateway/indexgatewaypb"
 	shipper_util "github.com/grafana/loki/pkg/storage/stores/shipper/util"
 	"github.com/grafana/loki/pkg/util"
-	util_log "github.com/grafana/loki/pkg/util/log"
 	util_math "github.com/grafana/loki/pkg/util/math"
+	"github.com/grafana/loki/pkg/util/spanlogger"
 )
 
 const (
 	maxQueriesPerGrpc      = 100
 	maxConcurrentGrpcCalls = 10
+
+	// defaultMaxFanout caps how many replicas are queried in parallel for a single batch
+	// when in ring mode.
+	defaultMaxFanout = 2
+
+	// defaultHedgingDelay is how long the first wave of replicas gets to satisfy every
+	// QueryKey in a batch before a hedged request is dispatched to an additional replica.
+	defaultHedgingDelay = 50 * time.Millisecond
+
+	// defaultMaxRetries is the default number of additional attempts for idempotent QueryIndex
+	// calls that fail with a retriable gRPC status.
+	defaultMaxRetries = 2
+
+	// defaultRetryBackoff is the default base delay for the exponential retry backoff.
+	defaultRetryBackoff = 100 * time.Millisecond
+
+	// defaultBreakerThreshold is the default number of consecutive failures against an address
+	// before its circuit breaker trips.
+	defaultBreakerThreshold = 5
+
+	// defaultBreakerCooldown is the default duration a tripped circuit breaker stays open.
+	defaultBreakerCooldown = 30 * time.Second
 )
 
 // IndexGatewayClientConfig configures the Index Gateway client used to
@@ -64,6 +88,55 @@ type IndexGatewayClientConfig struct {
 	//
 	// Only relevant for the simple mode.
 	Address string `yaml:"server_address,omitempty"`
+
+	// MaxFanout is the maximum number of Index Gateway replicas queried in parallel for a single
+	// batch. Values <= 1 disable fan-out: the client queries one replica at a time, as before.
+	//
+	// Only relevant for the ring mode.
+	MaxFanout int `yaml:"max_fanout"`
+
+	// HedgingDelay is how long the initial fan-out wave is given to satisfy every QueryKey in a
+	// batch before the client falls back to dispatching the remaining, unsatisfied queries to an
+	// additional replica.
+	//
+	// Only relevant for the ring mode.
+	HedgingDelay time.Duration `yaml:"hedging_delay"`
+
+	// MaxRetries is the number of additional attempts made for idempotent QueryIndex calls that
+	// fail with a retriable gRPC status (Unavailable, DeadlineExceeded).
+	MaxRetries int `yaml:"max_retries"`
+
+	// RetryBackoff is the base delay used to compute the exponential backoff, with jitter,
+	// between retried QueryIndex attempts.
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+
+	// BreakerThreshold is the number of consecutive failures against an Index Gateway address
+	// before the client's per-address circuit breaker trips and short-circuits further calls to it.
+	BreakerThreshold int `yaml:"breaker_threshold"`
+
+	// BreakerCooldown is how long a tripped circuit breaker stays open, short-circuiting calls to
+	// that address, before allowing another attempt through.
+	BreakerCooldown time.Duration `yaml:"breaker_cooldown"`
+
+	// ZoneAwarenessEnabled, when true, makes ringModeDoQueries stably prefer replicas in
+	// PreferredZone before falling back to replicas in other zones.
+	//
+	// Only relevant for the ring mode.
+	ZoneAwarenessEnabled bool `yaml:"zone_awareness_enabled"`
+
+	// PreferredZone is the availability zone this client should prefer when ZoneAwarenessEnabled
+	// is true, typically set to the zone the calling component itself runs in to avoid cross-AZ
+	// hops.
+	//
+	// Only relevant for the ring mode.
+	PreferredZone string `yaml:"preferred_zone"`
+
+	// ShuffleShardSize, when > 0, bounds each tenant to a deterministic subring of this many
+	// Index Gateway instances, so repeated queries for the same tenant consistently land on the
+	// same bounded subset of replicas, improving cache warmth on the gateway side.
+	//
+	// Only relevant for the ring mode.
+	ShuffleShardSize int `yaml:"shuffle_shard_size"`
 }
 
 // RegisterFlagsWithPrefix register client-specific flags with the given prefix.
@@ -72,6 +145,15 @@ type IndexGatewayClientConfig struct {
 func (i *IndexGatewayClientConfig) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
 	i.GRPCClientConfig.RegisterFlagsWithPrefix(prefix+".grpc", f)
 	f.StringVar(&i.Address, prefix+".server-address", "", "Hostname or IP of the Index Gateway gRPC server running in simple mode.")
+	f.IntVar(&i.MaxFanout, prefix+".max-fanout", defaultMaxFanout, "Maximum number of healthy Index Gateway replicas queried in parallel per batch when in ring mode. Values <= 1 disable fan-out.")
+	f.DurationVar(&i.HedgingDelay, prefix+".hedging-delay", defaultHedgingDelay, "How long to wait for the initial fan-out wave to satisfy every query in a batch before hedging the unsatisfied subset to an additional Index Gateway replica. Only relevant when max-fanout leaves replicas in reserve.")
+	f.IntVar(&i.MaxRetries, prefix+".max-retries", defaultMaxRetries, "Number of additional attempts for idempotent QueryIndex calls that fail with a retriable gRPC status.")
+	f.DurationVar(&i.RetryBackoff, prefix+".retry-backoff", defaultRetryBackoff, "Base delay for the exponential backoff, with jitter, applied between retried QueryIndex attempts.")
+	f.IntVar(&i.BreakerThreshold, prefix+".breaker-threshold", defaultBreakerThreshold, "Number of consecutive failures against an Index Gateway address before its circuit breaker trips.")
+	f.DurationVar(&i.BreakerCooldown, prefix+".breaker-cooldown", defaultBreakerCooldown, "How long a tripped circuit breaker stays open, short-circuiting calls to that address, before allowing another attempt through.")
+	f.BoolVar(&i.ZoneAwarenessEnabled, prefix+".zone-awareness-enabled", false, "True to enable zone-awareness and stably prefer replicas in preferred-zone before falling back across zones.")
+	f.StringVar(&i.PreferredZone, prefix+".preferred-zone", "", "Availability zone to prefer when zone-awareness-enabled is true. Typically set to the zone the calling component runs in.")
+	f.IntVar(&i.ShuffleShardSize, prefix+".shuffle-shard-size", 0, "Size of the per-tenant subring of Index Gateway instances to query. 0 disables shuffle sharding and uses the full ring.")
 }
 
 func (i *IndexGatewayClientConfig) RegisterFlags(f *flag.FlagSet) {
@@ -82,6 +164,10 @@ type GatewayClient struct {
 	cfg IndexGatewayClientConfig
 
 	storeGatewayClientRequestDuration *prometheus.HistogramVec
+	hedgedRequestsTotal               prometheus.Counter
+	hedgedWinsTotal                   prometheus.Counter
+	crossZoneFallbackTotal            prometheus.Counter
+	subringSize                       *prometheus.GaugeVec
 
 	conn       *grpc.ClientConn
 	grpcClient indexgatewaypb.IndexGatewayClient
@@ -89,6 +175,14 @@ type GatewayClient struct {
 	pool *ring_client.Pool
 
 	ring ring.ReadRing
+
+	// breakers holds one circuit breaker per Index Gateway address. It lives alongside pool so
+	// its state is shared across goroutines but scoped to this client, not the process.
+	breakers *addressBreakerRegistry
+
+	// logger is used for all query-path logging, so embedders can route index gateway client
+	// logs into their own pipeline instead of the package-global util_log.Logger.
+	logger log.Logger
 }
 
 // NewGatewayClient instantiates a new client used to communicate with an Index Gateway instance.
@@ -104,13 +198,39 @@ func NewGatewayClient(cfg IndexGatewayClientConfig, r prometheus.Registerer, log
 			Help:      "Time (in seconds) spent serving requests when using boltdb shipper store gateway",
 			Buckets:   instrument.DefBuckets,
 		}, []string{"operation", "status_code"}),
-		ring: cfg.Ring,
+		hedgedRequestsTotal: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "hedged_requests_total",
+			Help:      "Total number of hedged requests sent to an additional Index Gateway replica because the initial fan-out wave did not satisfy every query in the batch in time.",
+		}),
+		hedgedWinsTotal: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "hedged_wins_total",
+			Help:      "Total number of batches completed after a hedged request was sent to an additional replica, whichever replica supplied the final results.",
+		}),
+		crossZoneFallbackTotal: promauto.With(r).NewCounter(prometheus.CounterOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "cross_zone_fallback_total",
+			Help:      "Total number of queries sent to an Index Gateway replica outside of the preferred zone.",
+		}),
+		subringSize: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "loki_boltdb_shipper",
+			Name:      "index_gateway_subring_size",
+			Help:      "Size of the per-tenant Index Gateway shuffle-shard subring, when shuffle sharding is enabled.",
+		}, []string{"tenant"}),
+		ring:     cfg.Ring,
+		breakers: newAddressBreakerRegistry(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		logger:   logger,
 	}
 
 	dialOpts, err := cfg.GRPCClientConfig.DialOption(grpcclient.Instrument(sgClient.storeGatewayClientRequestDuration))
 	if err != nil {
 		return nil, errors.Wrap(err, "index gateway grpc dial option")
 	}
+	dialOpts = append(dialOpts,
+		grpc.WithChainUnaryInterceptor(unaryClientInterceptor(sgClient.breakers)),
+		grpc.WithChainStreamInterceptor(streamClientInterceptor(cfg, sgClient.breakers)),
+	)
 
 	if sgClient.cfg.Mode == indexgateway.RingMode {
 		factory := func(addr string) (ring_client.PoolClient, error) {
@@ -164,27 +284,93 @@ func (s *GatewayClient) doQueries(ctx context.Context, queries []index.Query, ca
 
 	for _, query := range queries {
 		queryKeyQueryMap[shipper_util.QueryKey(query)] = query
-		gatewayQueries = append(gatewayQueries, &indexgatewaypb.IndexQuery{
-			TableName:        query.TableName,
-			HashValue:        query.HashValue,
-			RangeValuePrefix: query.RangeValuePrefix,
-			RangeValueStart:  query.RangeValueStart,
-			ValueEqual:       query.ValueEqual,
-		})
+		gatewayQueries = append(gatewayQueries, toGatewayQuery(query))
 	}
 
 	if s.cfg.Mode == indexgateway.RingMode {
 		return s.ringModeDoQueries(ctx, gatewayQueries, queryKeyQueryMap, callback)
 	}
 
-	return s.clientDoQueries(ctx, gatewayQueries, queryKeyQueryMap, callback, s.grpcClient)
+	return s.clientDoQueries(ctx, gatewayQueries, queryKeyQueryMap, nil, callback, s.grpcClient, spanlogger.FromContext(ctx, s.logger))
+}
+
+func toGatewayQuery(query index.Query) *indexgatewaypb.IndexQuery {
+	return &indexgatewaypb.IndexQuery{
+		TableName:        query.TableName,
+		HashValue:        query.HashValue,
+		RangeValuePrefix: query.RangeValuePrefix,
+		RangeValueStart:  query.RangeValueStart,
+		ValueEqual:       query.ValueEqual,
+	}
+}
+
+// filterGatewayQueries rebuilds the gRPC query list for the given subset of queries. It's used
+// when falling back to additional replicas for QueryKeys a previous fan-out wave didn't satisfy.
+func filterGatewayQueries(queries map[string]index.Query) []*indexgatewaypb.IndexQuery {
+	out := make([]*indexgatewaypb.IndexQuery, 0, len(queries))
+	for _, query := range queries {
+		out = append(out, toGatewayQuery(query))
+	}
+	return out
+}
+
+// queryKeyTracker tracks, across concurrently queried replicas, which QueryKeys in a batch have
+// already produced a result. It lets callers dedupe rows across replicas (preferring whichever
+// replica answers first) and ask which QueryKeys are still outstanding.
+type queryKeyTracker struct {
+	mtx       sync.Mutex
+	remaining map[string]struct{}
+}
+
+func newQueryKeyTracker(queryKeyQueryMap map[string]index.Query) *queryKeyTracker {
+	remaining := make(map[string]struct{}, len(queryKeyQueryMap))
+	for key := range queryKeyQueryMap {
+		remaining[key] = struct{}{}
+	}
+	return &queryKeyTracker{remaining: remaining}
+}
+
+// markSeen records key as satisfied and reports whether this call was the first to do so.
+func (t *queryKeyTracker) markSeen(key string) (first bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if _, ok := t.remaining[key]; !ok {
+		return false
+	}
+	delete(t.remaining, key)
+	return true
+}
+
+func (t *queryKeyTracker) done() bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return len(t.remaining) == 0
+}
+
+func (t *queryKeyTracker) remainingCount() int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return len(t.remaining)
+}
+
+// outstanding returns the subset of queryKeyQueryMap that hasn't been satisfied yet.
+func (t *queryKeyTracker) outstanding(queryKeyQueryMap map[string]index.Query) map[string]index.Query {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	out := make(map[string]index.Query, len(t.remaining))
+	for key := range t.remaining {
+		out[key] = queryKeyQueryMap[key]
+	}
+	return out
 }
 
 // clientDoQueries send a query request to an Index Gateway instance using the given gRPC client.
 //
-// It is used by both, simple and ring mode.
+// It is used by both, simple and ring mode. tracker may be nil, in which case every row received
+// is delivered to callback; this is only safe when a single replica is ever queried for the
+// batch, as is the case outside of ring mode.
 func (s *GatewayClient) clientDoQueries(ctx context.Context, gatewayQueries []*indexgatewaypb.IndexQuery,
-	queryKeyQueryMap map[string]index.Query, callback index.QueryPagesCallback, client indexgatewaypb.IndexGatewayClient) error {
+	queryKeyQueryMap map[string]index.Query, tracker *queryKeyTracker, callback index.QueryPagesCallback, client indexgatewaypb.IndexGatewayClient, logger log.Logger) error {
 	streamer, err := client.QueryIndex(ctx, &indexgatewaypb.QueryIndexRequest{Queries: gatewayQueries})
 	if err != nil {
 		return errors.Wrap(err, "query index")
@@ -200,9 +386,13 @@ func (s *GatewayClient) clientDoQueries(ctx context.Context, gatewayQueries []*i
 		}
 		query, ok := queryKeyQueryMap[resp.QueryKey]
 		if !ok {
-			level.Error(util_log.Logger).Log("msg", fmt.Sprintf("unexpected %s QueryKey received, expected queries %s", resp.QueryKey, fmt.Sprint(queryKeyQueryMap)))
+			level.Error(logger).Log("msg", "unexpected QueryKey received", "query_key", resp.QueryKey, "expected_queries", fmt.Sprint(queryKeyQueryMap))
 			return fmt.Errorf("unexpected %s QueryKey received", resp.QueryKey)
 		}
+		if tracker != nil && !tracker.markSeen(resp.QueryKey) {
+			// A faster replica already produced this QueryKey; drop the duplicate.
+			continue
+		}
 		if !callback(query, &readBatch{resp}) {
 			return nil
 		}
@@ -211,51 +401,235 @@ func (s *GatewayClient) clientDoQueries(ctx context.Context, gatewayQueries []*i
 	return nil
 }
 
+// doQueriesAgainst resolves addr to a pooled gRPC client and runs clientDoQueries against it,
+// logging rather than propagating per-replica errors so that callers can keep trying other
+// replicas for the remaining QueryKeys.
+func (s *GatewayClient) doQueriesAgainst(ctx context.Context, addr string, gatewayQueries []*indexgatewaypb.IndexQuery,
+	queryKeyQueryMap map[string]index.Query, tracker *queryKeyTracker, callback index.QueryPagesCallback, logger log.Logger) {
+	genericClient, err := s.pool.GetClientFor(addr)
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get client for instance", "err", err)
+		return
+	}
+
+	client := genericClient.(indexgatewaypb.IndexGatewayClient)
+	if err := s.clientDoQueries(ctx, gatewayQueries, queryKeyQueryMap, tracker, callback, client, logger); err != nil {
+		level.Error(logger).Log("msg", "client do queries failed for instance", "err", err)
+	}
+}
+
+// replicaAddrsFor resolves the ordered list of Index Gateway addresses that should be tried for
+// userID, along with the subset of those addresses that live outside of cfg.PreferredZone.
+//
+// When cfg.ShuffleShardSize is set, the ring is first narrowed to a deterministic per-tenant
+// subring of that size, so a given tenant consistently lands on the same bounded set of
+// instances across calls, improving cache warmth on the gateway side. When cfg.ZoneAwarenessEnabled
+// is set, addresses in cfg.PreferredZone are shuffled and ordered ahead of addresses in other
+// zones, so same-zone replicas are preferred without starving cross-zone ones entirely.
+func (s *GatewayClient) replicaAddrsFor(userID string) (addrs []string, crossZone map[string]bool, err error) {
+	r := s.ring
+	if s.cfg.ShuffleShardSize > 0 {
+		r = r.ShuffleShard(userID, s.cfg.ShuffleShardSize)
+		s.subringSize.WithLabelValues(userID).Set(float64(s.cfg.ShuffleShardSize))
+	}
+
+	bufDescs, bufHosts, bufZones := ring.MakeBuffersForGet()
+
+	key := util.TokenFor(userID, "" /* labels */)
+	rs, err := r.Get(key, ring.WriteNoExtend, bufDescs, bufHosts, bufZones)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "index gateway get ring")
+	}
+
+	instances := rs.Instances
+	crossZone = make(map[string]bool)
+
+	if !s.cfg.ZoneAwarenessEnabled || s.cfg.PreferredZone == "" {
+		addrs = make([]string, 0, len(instances))
+		for _, inst := range instances {
+			addrs = append(addrs, inst.Addr)
+		}
+		// shuffle addresses to make sure we don't always access the same Index Gateway instances in sequence for same tenant.
+		rand.Shuffle(len(addrs), func(i, j int) {
+			addrs[i], addrs[j] = addrs[j], addrs[i]
+		})
+		return s.deprioritizeBrokenAddrs(addrs), crossZone, nil
+	}
+
+	var preferred, other []string
+	for _, inst := range instances {
+		if inst.Zone == s.cfg.PreferredZone {
+			preferred = append(preferred, inst.Addr)
+		} else {
+			other = append(other, inst.Addr)
+			crossZone[inst.Addr] = true
+		}
+	}
+	rand.Shuffle(len(preferred), func(i, j int) { preferred[i], preferred[j] = preferred[j], preferred[i] })
+	rand.Shuffle(len(other), func(i, j int) { other[i], other[j] = other[j], other[i] })
+
+	addrs = make([]string, 0, len(preferred)+len(other))
+	addrs = append(addrs, preferred...)
+	addrs = append(addrs, other...)
+
+	return s.deprioritizeBrokenAddrs(addrs), crossZone, nil
+}
+
+// deprioritizeBrokenAddrs reorders addrs so that any address whose circuit breaker is currently
+// open sorts after every address that's allowed to be dialed, preserving relative order within
+// each group. That keeps a known-bad replica from occupying one of the limited MaxFanout/fallback
+// slots ahead of a healthy one, while still falling back to it if every other replica is
+// exhausted instead of dropping it outright.
+func (s *GatewayClient) deprioritizeBrokenAddrs(addrs []string) []string {
+	if s.breakers == nil {
+		return addrs
+	}
+
+	ordered := make([]string, 0, len(addrs))
+	var open []string
+	for _, addr := range addrs {
+		if s.breakers.allow(addr) {
+			ordered = append(ordered, addr)
+		} else {
+			open = append(open, addr)
+		}
+	}
+	return append(ordered, open...)
+}
+
+// replicaDispatchFunc queries a single replica for gatewayQueries, delivering rows to callback
+// (bound in the closure) and recording satisfied QueryKeys against tracker. Implementations
+// shouldn't return an error to the caller; failures are only logged, so sibling replicas still
+// get a chance.
+type replicaDispatchFunc func(ctx context.Context, addr string, gatewayQueries []*indexgatewaypb.IndexQuery, queryKeyQueryMap map[string]index.Query, tracker *queryKeyTracker, logger log.Logger)
+
+// runHedgedFanout dispatches gatewayQueries to up to fanout of addrs in parallel via dispatch,
+// then, once that wave has finished or hedgingDelay has elapsed, whichever comes first, falls
+// back across the remaining addrs for just the still-outstanding subset of queries, if tracker
+// isn't fully satisfied yet.
+//
+// It's factored out of ringModeDoQueries so the hedge/fallback/cancellation control flow can be
+// exercised in tests against a fake dispatch func, without a real ring or gRPC pool.
+func runHedgedFanout(ctx context.Context, addrs []string, fanout int, hedgingDelay time.Duration,
+	gatewayQueries []*indexgatewaypb.IndexQuery, queryKeyQueryMap map[string]index.Query, tracker *queryKeyTracker,
+	crossZone map[string]bool, onHedge, onCrossZone func(), logger log.Logger, dispatch replicaDispatchFunc) (usedFallback bool, err error) {
+	fanoutCtx, cancelFanout := context.WithCancel(ctx)
+	defer cancelFanout()
+
+	var wg sync.WaitGroup
+	for _, addr := range addrs[:fanout] {
+		addr := addr
+		if crossZone[addr] {
+			onCrossZone()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dispatch(fanoutCtx, addr, gatewayQueries, queryKeyQueryMap, tracker, log.With(logger, "replica_addr", addr))
+		}()
+	}
+
+	fanoutDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(fanoutDone)
+	}()
+
+	select {
+	case <-fanoutDone:
+	case <-time.After(hedgingDelay):
+	case <-ctx.Done():
+		// fanoutCtx is derived from ctx, so the wave-1 goroutines will observe the cancellation
+		// too; wait for them to unwind before returning so none outlive this call and keep
+		// invoking callback after our caller has moved on.
+		cancelFanout()
+		wg.Wait()
+		return false, ctx.Err()
+	}
+
+	// Fall back across the remaining replicas in the replication set for whatever QueryKeys the
+	// fan-out wave above hasn't satisfied yet, e.g. because a replica hasn't downloaded the
+	// relevant index file (the hedging-delay timer expired) or came back empty-handed for it (the
+	// wave finished early but incomplete). Either way, the first fallback dispatch below is a
+	// hedge: we're paying for an additional replica because the first wave didn't fully pan out,
+	// so it's counted as one regardless of which branch above let us get here.
+	for _, addr := range addrs[fanout:] {
+		if tracker.done() {
+			break
+		}
+		if !usedFallback {
+			usedFallback = true
+			onHedge()
+		}
+		if crossZone[addr] {
+			onCrossZone()
+		}
+
+		outstanding := tracker.outstanding(queryKeyQueryMap)
+		dispatch(ctx, addr, filterGatewayQueries(outstanding), outstanding, tracker, log.With(logger, "replica_addr", addr))
+	}
+
+	if tracker.done() {
+		// Every QueryKey is now covered, so there's no point letting slower wave-1 replicas keep running.
+		cancelFanout()
+	}
+	wg.Wait()
+
+	return usedFallback, nil
+}
+
 // ringModeDoQueries prepares an index query to be sent to the Index Gateway, and then sends it
 // using the clientDoQueries implementation.
 //
 // The preparation and sending phase includes:
-// 1. Extracting the tenant name from the query.
-// 2. Fetching different Index Gateway instances assigned to the extracted tenant.
-// 3. Iterating in parallel over all fetched Index Gateway instances, getting their gRPC connections
-//  from the pool and invoking clientDoQueries using their client.
+//  1. Extracting the tenant name from the query.
+//  2. Fetching different Index Gateway instances assigned to the extracted tenant, subject to
+//     zone-awareness and shuffle sharding (see replicaAddrsFor).
+//  3. Dispatching the batch in parallel to up to cfg.MaxFanout replicas, then, once that wave has
+//     finished or cfg.HedgingDelay has elapsed, whichever comes first, falling back across the
+//     remaining replicas in the replication set for just the still-unsatisfied subset of queries.
 func (s *GatewayClient) ringModeDoQueries(ctx context.Context, gatewayQueries []*indexgatewaypb.IndexQuery, queryKeyQueryMap map[string]index.Query, callback index.QueryPagesCallback) error {
 	userID, err := tenant.TenantID(ctx)
 	if err != nil {
 		return errors.Wrap(err, "index gateway client get tenant ID")
 	}
 
-	bufDescs, bufHosts, bufZones := ring.MakeBuffersForGet()
+	logger := log.With(spanlogger.FromContext(ctx, s.logger), "tenant", userID, "query_count", len(queryKeyQueryMap))
 
-	key := util.TokenFor(userID, "" /* labels */)
-	rs, err := s.ring.Get(key, ring.WriteNoExtend, bufDescs, bufHosts, bufZones)
+	addrs, crossZone, err := s.replicaAddrsFor(userID)
 	if err != nil {
-		return errors.Wrap(err, "index gateway get ring")
+		return err
 	}
 
-	addrs := rs.GetAddresses()
-	// shuffle addresses to make sure we don't always access the same Index Gateway instances in sequence for same tenant.
-	rand.Shuffle(len(addrs), func(i, j int) {
-		addrs[i], addrs[j] = addrs[j], addrs[i]
-	})
+	fanout := s.cfg.MaxFanout
+	if fanout < 1 {
+		fanout = 1
+	}
+	if fanout > len(addrs) {
+		fanout = len(addrs)
+	}
 
-	for _, addr := range addrs {
-		genericClient, err := s.pool.GetClientFor(addr)
-		if err != nil {
-			level.Error(util_log.Logger).Log("msg", fmt.Sprintf("failed to get client for instance %s", addr), "err", err)
-			continue
-		}
+	tracker := newQueryKeyTracker(queryKeyQueryMap)
 
-		client := (genericClient.(indexgatewaypb.IndexGatewayClient))
-		if err := s.clientDoQueries(ctx, gatewayQueries, queryKeyQueryMap, callback, client); err != nil {
-			level.Error(util_log.Logger).Log("msg", fmt.Sprintf("client do queries failed for instance %s", addr), "err", err)
-			continue
-		}
+	dispatch := func(ctx context.Context, addr string, gatewayQueries []*indexgatewaypb.IndexQuery, queryKeyQueryMap map[string]index.Query, tracker *queryKeyTracker, logger log.Logger) {
+		s.doQueriesAgainst(ctx, addr, gatewayQueries, queryKeyQueryMap, tracker, callback, logger)
+	}
+
+	usedFallback, err := runHedgedFanout(ctx, addrs, fanout, s.cfg.HedgingDelay, gatewayQueries, queryKeyQueryMap, tracker,
+		crossZone, s.hedgedRequestsTotal.Inc, s.crossZoneFallbackTotal.Inc, logger, dispatch)
+	if err != nil {
+		return errors.Wrap(err, "index gateway hedged fan-out")
+	}
 
-		return nil
+	if !tracker.done() {
+		return fmt.Errorf("index gateway replicationSet clientDoQueries: missing results for %d of %d queries", tracker.remainingCount(), len(queryKeyQueryMap))
 	}
 
-	return fmt.Errorf("index gateway replicationSet clientDoQueries")
+	if usedFallback {
+		s.hedgedWinsTotal.Inc()
+	}
+
+	return nil
 }
 
 func (s *GatewayClient) NewWriteBatch() index.WriteBatch {
@@ -0,0 +1,241 @@
+package shipper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Typed errors returned to callers in place of opaque gRPC status errors, so code at the client
+// boundary can use errors.Is/errors.As instead of inspecting gRPC codes directly.
+var (
+	ErrIndexGatewayNotFound          = errors.New("index gateway: not found")
+	ErrIndexGatewayResourceExhausted = errors.New("index gateway: resource exhausted")
+)
+
+// isQueryIndex reports whether method is IndexGatewayClient.QueryIndex, the only RPC the
+// interceptors below retry, since it's a read-only, idempotent query.
+func isQueryIndex(method string) bool {
+	return strings.HasSuffix(method, "/QueryIndex")
+}
+
+// unwrapStatusError turns a gRPC status error into the typed Go error callers expect, e.g. so
+// that errors.Is(err, context.Canceled) works across the client boundary.
+func unwrapStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	switch st.Code() {
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	case codes.NotFound:
+		return ErrIndexGatewayNotFound
+	case codes.ResourceExhausted:
+		return ErrIndexGatewayResourceExhausted
+	default:
+		return err
+	}
+}
+
+func isRetriableStatus(err error) bool {
+	st, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// backoffFor blocks for an exponentially increasing, jittered delay based on attempt, or until
+// ctx is done, whichever comes first. A non-positive base disables the wait entirely.
+func backoffFor(ctx context.Context, base time.Duration, attempt int) {
+	if base <= 0 {
+		return
+	}
+
+	d := base << attempt
+	d += time.Duration(rand.Int63n(int64(base) + 1))
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// addressCircuitBreaker is a consecutive-failure circuit breaker scoped to a single Index
+// Gateway address. It trips to "open" after threshold consecutive failures and stays open for
+// cooldown, so calls to a known-bad replica fail fast instead of paying connection/timeout cost.
+type addressCircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mtx       sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func (b *addressCircuitBreaker) allow() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return time.Now().After(b.openUntil)
+}
+
+func (b *addressCircuitBreaker) recordSuccess() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *addressCircuitBreaker) recordFailure() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// addressBreakerRegistry holds one addressCircuitBreaker per Index Gateway address, created
+// lazily on first use and shared across goroutines. It's kept on GatewayClient next to the
+// ring_client.Pool so breaker state persists for the client's lifetime, scoped per instance.
+type addressBreakerRegistry struct {
+	threshold int
+	cooldown  time.Duration
+
+	mtx      sync.Mutex
+	breakers map[string]*addressCircuitBreaker
+}
+
+func newAddressBreakerRegistry(threshold int, cooldown time.Duration) *addressBreakerRegistry {
+	return &addressBreakerRegistry{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  make(map[string]*addressCircuitBreaker),
+	}
+}
+
+func (r *addressBreakerRegistry) forAddress(addr string) *addressCircuitBreaker {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	b, ok := r.breakers[addr]
+	if !ok {
+		b = &addressCircuitBreaker{threshold: r.threshold, cooldown: r.cooldown}
+		r.breakers[addr] = b
+	}
+	return b
+}
+
+func (r *addressBreakerRegistry) allow(addr string) bool {
+	return r.forAddress(addr).allow()
+}
+
+// unaryClientInterceptor unwraps gRPC status errors into typed Go errors and records the outcome
+// of every call against the per-address circuit breaker in breakers.
+func unaryClientInterceptor(breakers *addressBreakerRegistry) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		addr := cc.Target()
+		if breakers != nil && !breakers.allow(addr) {
+			return status.Errorf(codes.Unavailable, "index gateway: circuit breaker open for %s", addr)
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if breakers != nil {
+			if err == nil {
+				breakers.forAddress(addr).recordSuccess()
+			} else {
+				breakers.forAddress(addr).recordFailure()
+			}
+		}
+
+		return unwrapStatusError(err)
+	}
+}
+
+// streamClientInterceptor checks the per-address circuit breaker before opening a stream,
+// retries opening QueryIndex streams on Unavailable/DeadlineExceeded with exponential backoff
+// and jitter, and wraps the resulting ClientStream so mid-stream errors are unwrapped and fed
+// back into the breaker too.
+func streamClientInterceptor(cfg IndexGatewayClientConfig, breakers *addressBreakerRegistry) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		addr := cc.Target()
+		if breakers != nil && !breakers.allow(addr) {
+			return nil, status.Errorf(codes.Unavailable, "index gateway: circuit breaker open for %s", addr)
+		}
+
+		retries := 0
+		if isQueryIndex(method) {
+			retries = cfg.MaxRetries
+		}
+
+		var (
+			cs  grpc.ClientStream
+			err error
+		)
+		for attempt := 0; attempt <= retries; attempt++ {
+			cs, err = streamer(ctx, desc, cc, method, opts...)
+			if err == nil || !isRetriableStatus(err) || attempt == retries {
+				break
+			}
+			backoffFor(ctx, cfg.RetryBackoff, attempt)
+		}
+
+		var breaker *addressCircuitBreaker
+		if breakers != nil {
+			breaker = breakers.forAddress(addr)
+			if err == nil {
+				breaker.recordSuccess()
+			} else {
+				breaker.recordFailure()
+			}
+		}
+
+		if err != nil {
+			return nil, unwrapStatusError(err)
+		}
+
+		return &errUnwrappingClientStream{ClientStream: cs, breaker: breaker}, nil
+	}
+}
+
+// errUnwrappingClientStream unwraps gRPC status errors returned from RecvMsg into typed Go
+// errors and records mid-stream failures against the per-address circuit breaker.
+type errUnwrappingClientStream struct {
+	grpc.ClientStream
+	breaker *addressCircuitBreaker
+}
+
+func (s *errUnwrappingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil && err != io.EOF {
+		if s.breaker != nil {
+			s.breaker.recordFailure()
+		}
+		return unwrapStatusError(err)
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+package shipper
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/loki/pkg/storage/stores/series/index"
+	"github.com/grafana/loki/pkg/storage/stores/shipper/indexgateway/indexgatewaypb"
+)
+
+// fakeQueryIndexStream feeds a fixed list of rows back from Recv, then io.EOF. It only exists to
+// satisfy the streaming client interface returned by IndexGatewayClient.QueryIndex; nothing in
+// these tests drives the embedded grpc.ClientStream directly.
+type fakeQueryIndexStream struct {
+	grpc.ClientStream
+	rows []*indexgatewaypb.QueryIndexResponse
+}
+
+func (f *fakeQueryIndexStream) Recv() (*indexgatewaypb.QueryIndexResponse, error) {
+	if len(f.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := f.rows[0]
+	f.rows = f.rows[1:]
+	return row, nil
+}
+
+// fakeReplica is a fake indexgatewaypb.IndexGatewayClient for a single Index Gateway instance. It
+// answers every QueryKey in queryKeys that the request asks for (matched on HashValue, which
+// queryKeyQueryMapFor sets to the key) with one row, after an optional delay, so tests can shape
+// which replica "wins" a given QueryKey.
+type fakeReplica struct {
+	queryKeys []string
+	delay     time.Duration
+}
+
+func (f *fakeReplica) QueryIndex(ctx context.Context, req *indexgatewaypb.QueryIndexRequest, _ ...grpc.CallOption) (indexgatewaypb.IndexGateway_QueryIndexClient, error) {
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	requested := make(map[string]bool, len(req.Queries))
+	for _, q := range req.Queries {
+		requested[q.HashValue] = true
+	}
+
+	rows := make([]*indexgatewaypb.QueryIndexResponse, 0, len(f.queryKeys))
+	for _, key := range f.queryKeys {
+		if requested[key] {
+			rows = append(rows, &indexgatewaypb.QueryIndexResponse{QueryKey: key})
+		}
+	}
+	return &fakeQueryIndexStream{rows: rows}, nil
+}
+
+// dispatchFor builds a replicaDispatchFunc that routes each addr to the fakeReplica in replicas,
+// via clientDoQueries, matching how doQueriesAgainst resolves a pooled client in production.
+func dispatchFor(replicas map[string]*fakeReplica, callback index.QueryPagesCallback) replicaDispatchFunc {
+	var s GatewayClient
+	return func(ctx context.Context, addr string, gatewayQueries []*indexgatewaypb.IndexQuery, queryKeyQueryMap map[string]index.Query, tracker *queryKeyTracker, logger log.Logger) {
+		replica, ok := replicas[addr]
+		if !ok {
+			return
+		}
+		_ = s.clientDoQueries(ctx, gatewayQueries, queryKeyQueryMap, tracker, callback, replica, logger)
+	}
+}
+
+func queryKeyQueryMapFor(keys ...string) map[string]index.Query {
+	m := make(map[string]index.Query, len(keys))
+	for _, k := range keys {
+		m[k] = index.Query{TableName: "table", HashValue: k}
+	}
+	return m
+}
+
+func TestRunHedgedFanout_DedupesAcrossReplicas(t *testing.T) {
+	queryKeyQueryMap := queryKeyQueryMapFor("a", "b")
+	replicas := map[string]*fakeReplica{
+		"replica-0": {queryKeys: []string{"a", "b"}},
+		"replica-1": {queryKeys: []string{"a", "b"}},
+	}
+
+	// Both replicas run concurrently, so the callback may be invoked from two goroutines at once.
+	var (
+		seenMtx sync.Mutex
+		seen    []string
+	)
+	callback := func(query index.Query, _ index.ReadBatchResult) bool {
+		seenMtx.Lock()
+		defer seenMtx.Unlock()
+		seen = append(seen, query.HashValue)
+		return true
+	}
+
+	tracker := newQueryKeyTracker(queryKeyQueryMap)
+	usedFallback, err := runHedgedFanout(context.Background(), []string{"replica-0", "replica-1"}, 2, time.Minute,
+		filterGatewayQueries(queryKeyQueryMap), queryKeyQueryMap, tracker, nil, func() {}, func() {}, log.NewNopLogger(), dispatchFor(replicas, callback))
+	require.NoError(t, err)
+	require.False(t, usedFallback)
+	require.True(t, tracker.done())
+	require.ElementsMatch(t, []string{"a", "b"}, seen)
+}
+
+func TestRunHedgedFanout_HedgedFallbackSatisfiesOnlyOutstandingSubset(t *testing.T) {
+	queryKeyQueryMap := queryKeyQueryMapFor("a", "b")
+	replicas := map[string]*fakeReplica{
+		// Answers "a" quickly but never answers "b" — the wave returns well before the hedging
+		// delay, but incomplete, which must count as a hedge just as much as the timer expiring.
+		"replica-0": {queryKeys: []string{"a"}, delay: 0},
+		// Would answer both, but only gets a chance at whatever's still outstanding once the
+		// wave above falls through to fallback, i.e. just "b".
+		"replica-1": {queryKeys: []string{"a", "b"}},
+	}
+
+	var seen []string
+	callback := func(query index.Query, _ index.ReadBatchResult) bool {
+		seen = append(seen, query.HashValue)
+		return true
+	}
+
+	hedged := false
+	tracker := newQueryKeyTracker(queryKeyQueryMap)
+	usedFallback, err := runHedgedFanout(context.Background(), []string{"replica-0", "replica-1"}, 1, 10*time.Millisecond,
+		filterGatewayQueries(queryKeyQueryMap), queryKeyQueryMap, tracker, nil, func() { hedged = true }, func() {}, log.NewNopLogger(), dispatchFor(replicas, callback))
+	require.NoError(t, err)
+	require.True(t, hedged)
+	require.True(t, usedFallback)
+	require.True(t, tracker.done())
+	require.ElementsMatch(t, []string{"a", "b"}, seen)
+}
+
+func TestRunHedgedFanout_HedgesOnTimerExpiryToo(t *testing.T) {
+	queryKeyQueryMap := queryKeyQueryMapFor("a", "b")
+	replicas := map[string]*fakeReplica{
+		// Still in flight when the hedging delay fires, so the select picks the timer branch
+		// rather than fanoutDone.
+		"replica-0": {queryKeys: []string{"a"}, delay: 50 * time.Millisecond},
+		"replica-1": {queryKeys: []string{"a", "b"}},
+	}
+
+	var seen []string
+	callback := func(query index.Query, _ index.ReadBatchResult) bool {
+		seen = append(seen, query.HashValue)
+		return true
+	}
+
+	hedged := false
+	tracker := newQueryKeyTracker(queryKeyQueryMap)
+	usedFallback, err := runHedgedFanout(context.Background(), []string{"replica-0", "replica-1"}, 1, 10*time.Millisecond,
+		filterGatewayQueries(queryKeyQueryMap), queryKeyQueryMap, tracker, nil, func() { hedged = true }, func() {}, log.NewNopLogger(), dispatchFor(replicas, callback))
+	require.NoError(t, err)
+	require.True(t, hedged)
+	require.True(t, usedFallback)
+	require.True(t, tracker.done())
+	require.ElementsMatch(t, []string{"b", "a"}, seen)
+}
+
+func TestRunHedgedFanout_ZeroFallbackCapacity(t *testing.T) {
+	queryKeyQueryMap := queryKeyQueryMapFor("a", "b")
+	replicas := map[string]*fakeReplica{
+		// Only ever answers "a"; there's nothing left in the replication set to fall back to for "b".
+		"replica-0": {queryKeys: []string{"a"}},
+	}
+
+	var seen []string
+	callback := func(query index.Query, _ index.ReadBatchResult) bool {
+		seen = append(seen, query.HashValue)
+		return true
+	}
+
+	tracker := newQueryKeyTracker(queryKeyQueryMap)
+	usedFallback, err := runHedgedFanout(context.Background(), []string{"replica-0"}, 1, 10*time.Millisecond,
+		filterGatewayQueries(queryKeyQueryMap), queryKeyQueryMap, tracker, nil, func() {}, func() {}, log.NewNopLogger(), dispatchFor(replicas, callback))
+	require.NoError(t, err)
+	require.False(t, usedFallback)
+	require.False(t, tracker.done())
+	require.Equal(t, 1, tracker.remainingCount())
+	require.ElementsMatch(t, []string{"a"}, seen)
+}
@@ -0,0 +1,179 @@
+// Package httpgateway exposes the Index Gateway's QueryIndex RPC over HTTP/JSON, for ad-hoc
+// debugging, scripting, and integration with tooling that doesn't speak gRPC.
+//
+// Rather than generating this from the proto definitions with grpc-gateway, the translation is
+// implemented by hand against the existing generated types. That keeps the proto build unchanged
+// and avoids the code-generation maintenance burden projects like Jaeger have since moved away
+// from.
+package httpgateway
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/weaveworks/common/instrument"
+
+	"github.com/grafana/loki/pkg/storage/stores/series/index"
+	"github.com/grafana/loki/pkg/storage/stores/shipper"
+)
+
+// RoutePath is where Register mounts the handler on the shared HTTP mux.
+const RoutePath = "/indexgateway/query"
+
+// Config configures the HTTP/JSON Index Gateway gateway.
+type Config struct {
+	// Enabled, when true, mounts the handler on the HTTP mux passed to Register.
+	Enabled bool `yaml:"enabled"`
+
+	// BearerToken, when non-empty, is the token callers must present as
+	// "Authorization: Bearer <token>" to reach the handler.
+	BearerToken string `yaml:"bearer_token"`
+}
+
+// RegisterFlagsWithPrefix registers gateway-specific flags with the given prefix.
+func (c *Config) RegisterFlagsWithPrefix(prefix string, f *flag.FlagSet) {
+	f.BoolVar(&c.Enabled, prefix+".enabled", false, "True to expose the Index Gateway's QueryIndex RPC over HTTP/JSON on the existing HTTP mux.")
+	f.StringVar(&c.BearerToken, prefix+".bearer-token", "", "Bearer token callers must present to reach the HTTP/JSON Index Gateway endpoint. If empty, the endpoint is unauthenticated.")
+}
+
+func (c *Config) RegisterFlags(f *flag.FlagSet) {
+	c.RegisterFlagsWithPrefix("index-gateway.http", f)
+}
+
+// Register mounts a Handler for client on mux at RoutePath, if cfg.Enabled. Operators reach it at
+// RoutePath, guarded by the handler's own bearer-token check against cfg.BearerToken; when that is
+// empty the endpoint is unauthenticated.
+func Register(mux *http.ServeMux, cfg Config, client *shipper.GatewayClient, r prometheus.Registerer) {
+	if !cfg.Enabled {
+		return
+	}
+	mux.Handle(RoutePath, NewHandler(client, cfg.BearerToken, r))
+}
+
+// queryIndexRequest mirrors the JSON shape of indexgatewaypb.QueryIndexRequest, so callers of the
+// gRPC surface can reuse the same request body over HTTP.
+type queryIndexRequest struct {
+	Queries []indexQuery `json:"queries"`
+}
+
+// indexQuery mirrors the JSON shape of indexgatewaypb.IndexQuery.
+type indexQuery struct {
+	TableName        string `json:"table_name"`
+	HashValue        string `json:"hash_value"`
+	RangeValuePrefix []byte `json:"range_value_prefix,omitempty"`
+	RangeValueStart  []byte `json:"range_value_start,omitempty"`
+	ValueEqual       []byte `json:"value_equal,omitempty"`
+}
+
+// row is streamed back to the caller as one JSON object per line, mirroring indexgatewaypb.Row.
+type row struct {
+	RangeValue []byte `json:"range_value"`
+	Value      []byte `json:"value"`
+}
+
+// errorLine is emitted as a trailing NDJSON line whenever the query fails. Rows may already have
+// been streamed by then, so the failure is reported in the body and the response keeps its 200
+// status.
+type errorLine struct {
+	Error string `json:"error"`
+}
+
+// Handler serves QueryIndex over HTTP/JSON on behalf of client, accepting the same query shape
+// as the gRPC request and streaming newline-delimited JSON rows back to the caller.
+type Handler struct {
+	client      *shipper.GatewayClient
+	bearerToken string
+
+	requestDuration *prometheus.HistogramVec
+}
+
+// NewHandler wraps client so it can be mounted on an existing HTTP mux, e.g.
+// mux.Handle("/indexgateway/query", NewHandler(client, cfg.BearerToken, registerer)). If
+// bearerToken is non-empty, requests must carry it as an "Authorization: Bearer <token>" header.
+func NewHandler(client *shipper.GatewayClient, bearerToken string, r prometheus.Registerer) *Handler {
+	return &Handler{
+		client:      client,
+		bearerToken: bearerToken,
+		requestDuration: promauto.With(r).NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "loki",
+			Name:      "index_gateway_http_request_duration_seconds",
+			Help:      "Time (in seconds) spent serving HTTP/JSON Index Gateway query requests.",
+			Buckets:   instrument.DefBuckets,
+		}, []string{"status_code"}),
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	statusCode := "200"
+	defer func() {
+		h.requestDuration.WithLabelValues(statusCode).Observe(time.Since(start).Seconds())
+	}()
+
+	if !h.authorized(req) {
+		statusCode = "401"
+		http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	var reqBody queryIndexRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		statusCode = "400"
+		http.Error(w, errors.Wrap(err, "decode query index request").Error(), http.StatusBadRequest)
+		return
+	}
+
+	queries := make([]index.Query, 0, len(reqBody.Queries))
+	for _, q := range reqBody.Queries {
+		queries = append(queries, index.Query{
+			TableName:        q.TableName,
+			HashValue:        q.HashValue,
+			RangeValuePrefix: q.RangeValuePrefix,
+			RangeValueStart:  q.RangeValueStart,
+			ValueEqual:       q.ValueEqual,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	enc := json.NewEncoder(bw)
+
+	err := h.client.QueryPages(req.Context(), queries, func(_ index.Query, batch index.ReadBatchResult) bool {
+		itr := batch.Iterator()
+		for itr.Next() {
+			if err := enc.Encode(row{RangeValue: itr.RangeValue(), Value: itr.Value()}); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		statusCode = "500"
+		_ = enc.Encode(errorLine{Error: err.Error()})
+	}
+}
+
+func (h *Handler) authorized(req *http.Request) bool {
+	if h.bearerToken == "" {
+		return true
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	given := strings.TrimPrefix(auth, "Bearer ")
+	// Constant-time compare: this is the only auth check guarding the endpoint, and a
+	// content-dependent early-exit comparison would leak the token one byte at a time to an
+	// attacker timing responses. Only the token's length is observable, since ConstantTimeCompare
+	// returns at once when the lengths differ.
+	return subtle.ConstantTimeCompare([]byte(given), []byte(h.bearerToken)) == 1
+}